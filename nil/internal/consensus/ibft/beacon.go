@@ -0,0 +1,171 @@
+package ibft
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/NilFoundation/nil/nil/internal/db"
+	"github.com/NilFoundation/nil/nil/internal/types"
+)
+
+// BeaconSource produces verifiable randomness for a height, e.g. by reading
+// a round from a drand-style public randomness beacon.
+type BeaconSource interface {
+	// EntryAtHeight returns the beacon entry attached to the context of the
+	// proposal built at height and checked against every gossiped envelope
+	// for that height (see checkBeaconEntry), so all validators agree on the
+	// seed gossip for that height carries. It is not consulted by core.IBFT's own
+	// proposer selection, which remains a plain round-robin regardless of
+	// whether a BeaconSource is configured. Implementations must be safe
+	// for concurrent use.
+	EntryAtHeight(ctx context.Context, height uint64) ([]byte, error)
+}
+
+// beaconScheduleEntry maps a height range to the BeaconSource serving it.
+type beaconScheduleEntry struct {
+	fromHeight uint64
+	source     BeaconSource
+}
+
+// BeaconSchedule resolves the BeaconSource active at a given height, the
+// same way ForkManager resolves ForkParams: the active entry is the latest
+// one whose fromHeight is <= height.
+type BeaconSchedule struct {
+	mu      sync.RWMutex
+	entries []beaconScheduleEntry
+}
+
+// NewBeaconSchedule builds a schedule that uses source from genesis.
+func NewBeaconSchedule(source BeaconSource) *BeaconSchedule {
+	return &BeaconSchedule{
+		entries: []beaconScheduleEntry{{fromHeight: 0, source: source}},
+	}
+}
+
+// AddFork registers source as active from fromHeight onward.
+func (s *BeaconSchedule) AddFork(fromHeight uint64, source BeaconSource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, beaconScheduleEntry{fromHeight: fromHeight, source: source})
+	sort.Slice(s.entries, func(a, b int) bool {
+		return s.entries[a].fromHeight < s.entries[b].fromHeight
+	})
+}
+
+// SourceAt returns the BeaconSource active at height.
+func (s *BeaconSchedule) SourceAt(height uint64) BeaconSource {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	active := s.entries[0].source
+	for _, e := range s.entries {
+		if e.fromHeight > height {
+			break
+		}
+		active = e.source
+	}
+	return active
+}
+
+// EntryAtHeight delegates to the BeaconSource active at height.
+func (s *BeaconSchedule) EntryAtHeight(ctx context.Context, height uint64) ([]byte, error) {
+	source := s.SourceAt(height)
+	if source == nil {
+		return nil, fmt.Errorf("no beacon source registered for height %d", height)
+	}
+	return source.EntryAtHeight(ctx, height)
+}
+
+// cachedBeaconSource memoizes entries from an upstream BeaconSource in db,
+// so a restarted node (or a node re-verifying a past proposal) doesn't need
+// to re-fetch from the external beacon endpoint.
+type cachedBeaconSource struct {
+	shardId  types.ShardId
+	upstream BeaconSource
+	db       db.DB
+}
+
+var beaconTableName = "ConsensusBeaconEntries"
+
+// NewCachedBeaconSource wraps upstream with a db-backed cache keyed by
+// (shardId, height).
+func NewCachedBeaconSource(shardId types.ShardId, upstream BeaconSource, store db.DB) BeaconSource {
+	return &cachedBeaconSource{shardId: shardId, upstream: upstream, db: store}
+}
+
+func beaconCacheKey(shardId types.ShardId, height uint64) []byte {
+	key := make([]byte, 8+8)
+	binary.BigEndian.PutUint64(key[:8], uint64(shardId))
+	binary.BigEndian.PutUint64(key[8:], height)
+	return key
+}
+
+func (c *cachedBeaconSource) EntryAtHeight(ctx context.Context, height uint64) ([]byte, error) {
+	key := beaconCacheKey(c.shardId, height)
+
+	tx, err := c.db.CreateRoTx(ctx)
+	if err == nil {
+		entry, getErr := tx.Get(beaconTableName, key)
+		tx.Rollback()
+		if getErr == nil && len(entry) != 0 {
+			return entry, nil
+		}
+	}
+
+	entry, err := c.upstream.EntryAtHeight(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+
+	wtx, err := c.db.CreateRwTx(ctx)
+	if err != nil {
+		return entry, nil
+	}
+	defer wtx.Rollback()
+	if err := wtx.Put(beaconTableName, key, entry); err == nil {
+		_ = wtx.Commit()
+	}
+
+	return entry, nil
+}
+
+type beaconEntryCtxKey struct{}
+
+// withBeaconEntry attaches the beacon entry for the height being proposed to
+// the ctx handed to validator.BuildProposal. beaconEntryFromContext is
+// unexported, so the execution package cannot read the entry back: it is not
+// written into the proposal's SSZ payload and execution.VerifyProposal does
+// not check it. The same entry is also attached to every outbound gossip
+// Envelope for the height (see newEnvelope) and checked on every inbound one
+// (see checkBeaconEntry), so a mismatched seed is rejected at the transport
+// boundary; that is the only place this package checks it. This
+// only stops a proposer from equivocating on the seed it builds under; it
+// does not change which validator core.IBFT selects as proposer for the
+// round (that selection is unmodified round-robin), so it is not a source
+// of proposer-selection randomness or bias resistance on its own.
+func withBeaconEntry(ctx context.Context, entry []byte) context.Context {
+	return context.WithValue(ctx, beaconEntryCtxKey{}, entry)
+}
+
+// beaconEntryFromContext returns the beacon entry attached by
+// withBeaconEntry, if any.
+func beaconEntryFromContext(ctx context.Context) ([]byte, bool) {
+	entry, ok := ctx.Value(beaconEntryCtxKey{}).([]byte)
+	return entry, ok
+}
+
+// beaconSeed fetches (and caches, via i.beaconSchedule) the beacon entry for
+// height. A nil beaconSchedule means no BeaconSource was configured, in
+// which case no beacon entry is attached to the proposal or checked on
+// gossiped envelopes. Either way, core.IBFT's own proposer selection is
+// untouched: it remains a plain round-robin, not seeded by this entry.
+func (i *backendIBFT) beaconSeed(ctx context.Context, height uint64) ([]byte, error) {
+	if i.beaconSchedule == nil {
+		return nil, nil
+	}
+	return i.beaconSchedule.EntryAtHeight(ctx, height)
+}
@@ -0,0 +1,219 @@
+package ibft
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/NilFoundation/nil/nil/common/bls"
+	"github.com/NilFoundation/nil/nil/go-ibft/messages"
+	"github.com/NilFoundation/nil/nil/internal/types"
+)
+
+// proposalDigest is the message BLS committed seals are expected to sign
+// over. It must match whatever core.IBFT hashes the raw proposal into for
+// its COMMIT step; since that hashing lives inside the vendored go-ibft
+// core and isn't exposed to Backend implementations, this reproduces it as
+// a plain digest of the raw proposal bytes. If go-ibft's COMMIT digest
+// ever diverges from this, aggregate verification must be updated to match.
+func proposalDigest(rawProposal []byte) []byte {
+	sum := sha256.Sum256(rawProposal)
+	return sum[:]
+}
+
+// BLSSigner holds a BLS12-381 private key and aggregates/verifies committed
+// seals produced under SigningSchemeBLS. It is independent of the ECDSA
+// Signer used for p2p message authentication (see transport.go); a node can
+// run with an ECDSA Signer only, a BLSSigner only, or both, depending on
+// which SigningScheme the active fork selects.
+type BLSSigner struct {
+	privateKey bls.PrivateKey
+	publicKey  bls.PublicKey
+}
+
+// NewBLSSigner derives a BLSSigner from a raw BLS12-381 private key. It
+// returns an error if key is not a valid scalar for the curve.
+func NewBLSSigner(key []byte) (*BLSSigner, error) {
+	sk, err := bls.PrivateKeyFromBytes(key)
+	if err != nil {
+		return nil, fmt.Errorf("parse BLS private key: %w", err)
+	}
+	return &BLSSigner{privateKey: sk, publicKey: sk.PublicKey()}, nil
+}
+
+// GetPublicKey returns the compressed BLS public key bytes.
+func (s *BLSSigner) GetPublicKey() []byte {
+	return s.publicKey.Compress()
+}
+
+// Sign produces this validator's individual BLS committed seal over digest.
+func (s *BLSSigner) Sign(digest []byte) (types.Signature, error) {
+	return s.privateKey.Sign(digest), nil
+}
+
+// Aggregate combines individual BLS committed-seal signatures into a single
+// aggregated signature.
+func (s *BLSSigner) Aggregate(sigs [][]byte) (types.Signature, error) {
+	agg, err := bls.AggregateSignatures(sigs)
+	if err != nil {
+		return nil, err
+	}
+	return types.Signature(agg), nil
+}
+
+// combineCommittedSeals folds the per-validator CommittedSeal signatures
+// collected for a round into the single types.Signature stored on the
+// inserted block. Under SigningSchemeECDSA this reproduces the existing
+// behavior (the last non-empty seal). Under SigningSchemeBLS the seals are
+// BLS-aggregated into an AggregatedSeal (one signature plus a bitmap of
+// which validators, by their index in i.validators, signed) and the
+// returned bytes are that seal's MarshalBinary encoding, so the header
+// still only carries a single blob regardless of validator set size, and
+// the bitmap travels with it instead of being discarded.
+func (i *backendIBFT) combineCommittedSeals(fork ForkParams, seals []*messages.CommittedSeal) (types.Signature, error) {
+	if fork.SigningScheme != SigningSchemeBLS {
+		var signature types.Signature
+		for _, seal := range seals {
+			if len(seal.Signature) != 0 {
+				signature = seal.Signature
+			}
+		}
+		return signature, nil
+	}
+	return i.aggregateBLSSeals(i.blsValidators, seals)
+}
+
+// AggregatedSeal is the BLS committed-seal payload stored on a block: a
+// single aggregated signature plus a bitmap of signer indices into the
+// validator set that was active at the block's height. It is (de)serialized
+// as a single blob so it fits in the types.Signature slot validator.InsertProposal
+// already accepts, without requiring a schema change to execution.Proposal.
+type AggregatedSeal struct {
+	Signature types.Signature
+	Bitmap    SignerBitmap
+}
+
+// MarshalBinary encodes the seal as [4-byte bitmap length BE][bitmap][signature].
+func (s *AggregatedSeal) MarshalBinary() []byte {
+	out := make([]byte, 4+len(s.Bitmap)+len(s.Signature))
+	binary.BigEndian.PutUint32(out[:4], uint32(len(s.Bitmap)))
+	copy(out[4:], s.Bitmap)
+	copy(out[4+len(s.Bitmap):], s.Signature)
+	return out
+}
+
+// UnmarshalAggregatedSeal decodes a blob produced by AggregatedSeal.MarshalBinary.
+func UnmarshalAggregatedSeal(data []byte) (*AggregatedSeal, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("aggregated seal too short: %d bytes", len(data))
+	}
+	bitmapLen := binary.BigEndian.Uint32(data[:4])
+	if 4+uint64(bitmapLen) > uint64(len(data)) {
+		return nil, fmt.Errorf("aggregated seal bitmap length %d exceeds payload", bitmapLen)
+	}
+	bitmap := append(SignerBitmap(nil), data[4:4+bitmapLen]...)
+	signature := append(types.Signature(nil), data[4+bitmapLen:]...)
+	return &AggregatedSeal{Signature: signature, Bitmap: bitmap}, nil
+}
+
+// SignerBitmap records which validators (by index into
+// ConsensusParams.Validators/BLSValidators, ordered the same way at every
+// node) contributed a seal, so the verifier can reconstruct the ordered
+// pubkey list passed to the aggregate-verify call without shipping the
+// pubkeys themselves.
+type SignerBitmap []byte
+
+// NewSignerBitmap allocates a bitmap large enough for n validators.
+func NewSignerBitmap(n int) SignerBitmap {
+	return make(SignerBitmap, (n+7)/8)
+}
+
+// Set marks validator index idx as having signed.
+func (b SignerBitmap) Set(idx int) {
+	b[idx/8] |= 1 << (uint(idx) % 8)
+}
+
+// IsSet reports whether validator index idx signed.
+func (b SignerBitmap) IsSet(idx int) bool {
+	return b[idx/8]&(1<<(uint(idx)%8)) != 0
+}
+
+// blsIndexOf maps each validator's BLS public key (see
+// ConsensusParams.BLSValidators) to its index in the bitmap, the key space
+// CommittedSeal.From actually carries once a validator dials
+// SigningSchemeBLS: ID() advertises the BLS key under that scheme, not the
+// static config.ValidatorInfo.PublicKey GetVotingPowers otherwise keys by.
+// Extracted as a pure function so the attribution logic is testable without
+// a live BLSSigner/bls crypto backend.
+func blsIndexOf(blsValidators [][]byte) map[string]int {
+	indexOf := make(map[string]int, len(blsValidators))
+	for idx, pubKey := range blsValidators {
+		indexOf[string(pubKey)] = idx
+	}
+	return indexOf
+}
+
+// blsPubKeysForBitmap re-derives the ordered BLS pubkey list for every
+// signer bitmap marks, for use in an aggregate-verify call.
+func blsPubKeysForBitmap(blsValidators [][]byte, bitmap SignerBitmap) [][]byte {
+	pubKeys := make([][]byte, 0, len(blsValidators))
+	for idx, pubKey := range blsValidators {
+		if bitmap.IsSet(idx) {
+			pubKeys = append(pubKeys, pubKey)
+		}
+	}
+	return pubKeys
+}
+
+func (i *backendIBFT) aggregateBLSSeals(blsValidators [][]byte, seals []*messages.CommittedSeal) (types.Signature, error) {
+	if i.blsSigner == nil {
+		return nil, fmt.Errorf("active fork requires BLS seals but no BLSSigner is configured")
+	}
+	if len(blsValidators) == 0 {
+		return nil, fmt.Errorf("active fork requires BLS seals but no ConsensusParams.BLSValidators are configured")
+	}
+	if len(seals) == 0 {
+		return nil, fmt.Errorf("no committed seals to aggregate")
+	}
+
+	indexOf := blsIndexOf(blsValidators)
+
+	bitmap := NewSignerBitmap(len(blsValidators))
+	sigs := make([][]byte, 0, len(seals))
+	for _, seal := range seals {
+		if len(seal.Signature) == 0 {
+			continue
+		}
+		idx, ok := indexOf[string(seal.From)]
+		if !ok {
+			return nil, fmt.Errorf("committed seal from unknown BLS validator %x", seal.From)
+		}
+		bitmap.Set(idx)
+		sigs = append(sigs, seal.Signature)
+	}
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("no non-empty committed seals to aggregate")
+	}
+
+	aggregated, err := i.blsSigner.Aggregate(sigs)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate BLS seals: %w", err)
+	}
+
+	seal := &AggregatedSeal{Signature: aggregated, Bitmap: bitmap}
+	return seal.MarshalBinary(), nil
+}
+
+// verifyAggregatedSeal re-derives the ordered BLS pubkey list from bitmap
+// against blsValidators (ConsensusParams.BLSValidators, index-aligned with
+// ConsensusParams.Validators) and checks the aggregated signature over
+// digest. Called from backendIBFT.InsertProposal, before the proposal is
+// handed to validator.InsertProposal, when the active fork uses
+// SigningSchemeBLS.
+func verifyAggregatedSeal(blsValidators [][]byte, seal *AggregatedSeal, digest []byte) (bool, error) {
+	pubKeys := blsPubKeysForBitmap(blsValidators, seal.Bitmap)
+	if len(pubKeys) == 0 {
+		return false, fmt.Errorf("aggregated seal has no signers set")
+	}
+	return bls.VerifyAggregate(pubKeys, digest, seal.Signature)
+}
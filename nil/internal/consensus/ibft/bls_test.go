@@ -0,0 +1,112 @@
+package ibft
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NilFoundation/nil/nil/go-ibft/messages"
+)
+
+func TestSignerBitmap(t *testing.T) {
+	bitmap := NewSignerBitmap(10)
+	bitmap.Set(0)
+	bitmap.Set(3)
+	bitmap.Set(9)
+
+	for idx := 0; idx < 10; idx++ {
+		want := idx == 0 || idx == 3 || idx == 9
+		if got := bitmap.IsSet(idx); got != want {
+			t.Errorf("IsSet(%d) = %v, want %v", idx, got, want)
+		}
+	}
+}
+
+func TestAggregatedSealMarshalRoundTrip(t *testing.T) {
+	bitmap := NewSignerBitmap(4)
+	bitmap.Set(1)
+	bitmap.Set(2)
+
+	seal := &AggregatedSeal{
+		Signature: []byte{1, 2, 3, 4, 5},
+		Bitmap:    bitmap,
+	}
+
+	data := seal.MarshalBinary()
+	got, err := UnmarshalAggregatedSeal(data)
+	if err != nil {
+		t.Fatalf("UnmarshalAggregatedSeal: %v", err)
+	}
+
+	if !bytes.Equal(got.Signature, seal.Signature) {
+		t.Errorf("Signature = %x, want %x", got.Signature, seal.Signature)
+	}
+	if !bytes.Equal(got.Bitmap, seal.Bitmap) {
+		t.Errorf("Bitmap = %x, want %x", got.Bitmap, seal.Bitmap)
+	}
+}
+
+func TestUnmarshalAggregatedSealRejectsTruncated(t *testing.T) {
+	if _, err := UnmarshalAggregatedSeal([]byte{0, 0}); err == nil {
+		t.Fatal("expected an error for a truncated aggregated seal")
+	}
+
+	oversizedLen := []byte{0, 0, 0, 100}
+	if _, err := UnmarshalAggregatedSeal(oversizedLen); err == nil {
+		t.Fatal("expected an error when the encoded bitmap length exceeds the payload")
+	}
+}
+
+// TestBLSIdentityAttributionRoundTrip exercises blsIndexOf/blsPubKeysForBitmap
+// together against a validator set, the path aggregateBLSSeals and
+// verifyAggregatedSeal actually use for attribution. It stands in for a full
+// aggregateBLSSeals/verifyAggregatedSeal round trip, which needs a real
+// BLSSigner backed by the bls package this snapshot of the repo doesn't have
+// available; this covers the bug that made that path fail for every signer
+// (attribution keyed by the static ECDSA Validators list instead of the BLS
+// key ID() actually advertises under SigningSchemeBLS).
+func TestBLSIdentityAttributionRoundTrip(t *testing.T) {
+	blsValidators := [][]byte{
+		[]byte("bls-pubkey-0"),
+		[]byte("bls-pubkey-1"),
+		[]byte("bls-pubkey-2"),
+	}
+
+	indexOf := blsIndexOf(blsValidators)
+	for wantIdx, pubKey := range blsValidators {
+		idx, ok := indexOf[string(pubKey)]
+		if !ok {
+			t.Fatalf("blsIndexOf missing entry for validator %d", wantIdx)
+		}
+		if idx != wantIdx {
+			t.Errorf("blsIndexOf[%q] = %d, want %d", pubKey, idx, wantIdx)
+		}
+	}
+
+	bitmap := NewSignerBitmap(len(blsValidators))
+	bitmap.Set(0)
+	bitmap.Set(2)
+
+	pubKeys := blsPubKeysForBitmap(blsValidators, bitmap)
+	want := [][]byte{blsValidators[0], blsValidators[2]}
+	if len(pubKeys) != len(want) {
+		t.Fatalf("blsPubKeysForBitmap returned %d keys, want %d", len(pubKeys), len(want))
+	}
+	for idx, pubKey := range pubKeys {
+		if !bytes.Equal(pubKey, want[idx]) {
+			t.Errorf("blsPubKeysForBitmap[%d] = %q, want %q", idx, pubKey, want[idx])
+		}
+	}
+}
+
+func TestAggregateBLSSealsRejectsUnknownSigner(t *testing.T) {
+	backend := &backendIBFT{blsSigner: &BLSSigner{}}
+	blsValidators := [][]byte{[]byte("bls-pubkey-0")}
+
+	seals := []*messages.CommittedSeal{
+		{From: []byte("not-a-configured-bls-validator"), Signature: []byte{1}},
+	}
+
+	if _, err := backend.aggregateBLSSeals(blsValidators, seals); err == nil {
+		t.Fatal("expected an error when a committed seal's sender has no BLSValidators entry")
+	}
+}
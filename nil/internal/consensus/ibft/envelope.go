@@ -0,0 +1,249 @@
+package ibft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/NilFoundation/nil/nil/common/logging"
+	"github.com/NilFoundation/nil/nil/internal/types"
+	gethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// VerifySignature checks that sig is a valid ECDSA signature by the holder
+// of pubKey over digest. pubKey and sig use the same encodings as Signer.
+func VerifySignature(pubKey, digest []byte, sig types.Signature) (bool, error) {
+	recovered, err := gethcrypto.SigToPub(digest, sig)
+	if err != nil {
+		return false, fmt.Errorf("recover pubkey from signature: %w", err)
+	}
+	return string(gethcrypto.CompressPubkey(recovered)) == string(pubKey), nil
+}
+
+// ibftProtoV2 and the envelope version range below describe the wire
+// formats understood by this node. ibftProtoV2 speaks no envelope at all (bare messages); ibftProto
+// ("/ibft/0.3") requires every message to be wrapped in an Envelope. Both
+// are accepted for one release so a mixed-version network can upgrade
+// without a hard fork; ibftProtoV2 support should be removed once the
+// network has fully migrated.
+const (
+	ibftProtoV2 = "/ibft/0.2"
+
+	minEnvelopeVersion uint32 = 1
+	maxEnvelopeVersion uint32 = 1
+)
+
+// Envelope wraps every consensus message exchanged on ibftProto with sender
+// authentication, replay protection and a negotiated protocol-version tag.
+// It is a plain Go struct, JSON-encoded on the transport boundary (see
+// Multicast and handleInboundEnvelope), not a protobuf message; Payload
+// holds the inner protoIBFT message bytes unchanged.
+type Envelope struct {
+	SenderPubKey []byte        `json:"senderPubKey"`
+	Nonce        uint64        `json:"nonce"`
+	ShardId      types.ShardId `json:"shardId"`
+	Height       uint64        `json:"height"`
+	Round        uint64        `json:"round"`
+	Version      uint32        `json:"version"`
+	// MessageType is the protoIBFT message kind Payload decodes to
+	// (MessageReq_RoundChange, MessageReq_Preprepare, ...), so duplicates
+	// can be keyed by (sender, height, round, type) without decoding
+	// Payload first.
+	MessageType int32  `json:"messageType"`
+	Payload     []byte `json:"payload"`
+	// BeaconEntry is the randomness beacon entry the sender built its
+	// proposal under at Height (see beacon.go). It is an anti-equivocation
+	// check, not a proposer-selection input: core.IBFT still picks the
+	// proposer by its own round-robin regardless of BeaconEntry. Empty when
+	// no BeaconSchedule is configured. It is part of the signed payload, so
+	// a sender can't attach one seed while proposing under another.
+	BeaconEntry []byte          `json:"beaconEntry,omitempty"`
+	Signature   types.Signature `json:"signature"`
+}
+
+// canonicalBytes returns the deterministic byte encoding signed over and
+// verified against; it excludes Signature itself.
+func (e *Envelope) canonicalBytes() []byte {
+	buf := make([]byte, 0, len(e.SenderPubKey)+8+8+8+8+4+4+len(e.BeaconEntry)+len(e.Payload))
+	buf = append(buf, e.SenderPubKey...)
+
+	var scratch [8]byte
+	binary.BigEndian.PutUint64(scratch[:], e.Nonce)
+	buf = append(buf, scratch[:]...)
+	binary.BigEndian.PutUint64(scratch[:], uint64(e.ShardId))
+	buf = append(buf, scratch[:]...)
+	binary.BigEndian.PutUint64(scratch[:], e.Height)
+	buf = append(buf, scratch[:]...)
+	binary.BigEndian.PutUint64(scratch[:], e.Round)
+	buf = append(buf, scratch[:]...)
+
+	var scratch32 [4]byte
+	binary.BigEndian.PutUint32(scratch32[:], e.Version)
+	buf = append(buf, scratch32[:]...)
+	binary.BigEndian.PutUint32(scratch32[:], uint32(e.MessageType))
+	buf = append(buf, scratch32[:]...)
+
+	buf = append(buf, e.BeaconEntry...)
+	buf = append(buf, e.Payload...)
+	return buf
+}
+
+// newEnvelope wraps payload (an already-marshaled protoIBFT message) for
+// sending, stamping it with this node's nonce, the negotiated protocol
+// version, and the beacon entry (if any) active for height, so receivers can
+// check the sender proposed/voted under the expected randomness seed.
+func (i *backendIBFT) newEnvelope(messageType int32, height, round uint64, payload []byte) *Envelope {
+	var beaconEntry []byte
+	if seed, err := i.beaconSeed(i.currentCtx(), height); err != nil {
+		i.logger.Error().Err(err).Uint64(logging.FieldHeight, height).
+			Msg("failed to fetch beacon entry for outbound envelope, sending without one")
+	} else {
+		beaconEntry = seed
+	}
+
+	return &Envelope{
+		SenderPubKey: i.signer.GetPublicKey(),
+		Nonce:        i.nonces.Add(1),
+		ShardId:      i.shardId,
+		Height:       height,
+		Round:        round,
+		Version:      maxEnvelopeVersion,
+		MessageType:  messageType,
+		Payload:      payload,
+		BeaconEntry:  beaconEntry,
+	}
+}
+
+// sign signs e's canonical bytes with signer and sets e.Signature.
+func (e *Envelope) sign(signer *Signer) error {
+	sig, err := signer.Sign(e.canonicalBytes())
+	if err != nil {
+		return fmt.Errorf("sign envelope: %w", err)
+	}
+	e.Signature = sig
+	return nil
+}
+
+// verifySignature checks e.Signature against e.SenderPubKey over e's
+// canonical bytes.
+func (e *Envelope) verifySignature() (bool, error) {
+	return VerifySignature(e.SenderPubKey, e.canonicalBytes(), e.Signature)
+}
+
+// checkVersion rejects envelopes outside the locally supported version
+// range, so a node never acts on a message it cannot correctly interpret.
+func (e *Envelope) checkVersion() error {
+	if e.Version < minEnvelopeVersion || e.Version > maxEnvelopeVersion {
+		return fmt.Errorf(
+			"envelope version %d outside supported range [%d, %d]",
+			e.Version, minEnvelopeVersion, maxEnvelopeVersion,
+		)
+	}
+	return nil
+}
+
+// replayKey identifies a message for deduplication purposes: the same
+// sender cannot usefully send two different messages of the same type for
+// the same (height, round), so the second one is always either a replay or
+// an equivocation.
+type replayKey struct {
+	sender      string
+	height      uint64
+	round       uint64
+	messageType int32
+}
+
+// envelopeReplayGuard drops duplicate envelopes keyed by
+// (sender, height, round, type). Entries are pruned whenever the guard
+// observes a higher height than it has seen before, since consensus never
+// revisits a past height.
+type envelopeReplayGuard struct {
+	mu        sync.Mutex
+	seen      map[replayKey]struct{}
+	maxHeight uint64
+}
+
+func newEnvelopeReplayGuard() *envelopeReplayGuard {
+	return &envelopeReplayGuard{seen: make(map[replayKey]struct{})}
+}
+
+// Admit reports whether envelope e should be processed: false means it is a
+// duplicate (or an equivocation under the same key) and must be dropped.
+func (g *envelopeReplayGuard) Admit(e *Envelope) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if e.Height > g.maxHeight {
+		g.maxHeight = e.Height
+		for k := range g.seen {
+			if k.height < e.Height {
+				delete(g.seen, k)
+			}
+		}
+	}
+
+	key := replayKey{
+		sender:      string(e.SenderPubKey),
+		height:      e.Height,
+		round:       e.Round,
+		messageType: e.MessageType,
+	}
+	if _, dup := g.seen[key]; dup {
+		return false
+	}
+	g.seen[key] = struct{}{}
+	return true
+}
+
+// verifyEnvelope runs the full acceptance check for an inbound envelope:
+// version negotiation, signature, beacon entry, then replay protection. It
+// must be called before an envelope's Payload is handed to core.IBFT.
+func (i *backendIBFT) verifyEnvelope(e *Envelope) error {
+	if err := e.checkVersion(); err != nil {
+		return err
+	}
+
+	ok, err := e.verifySignature()
+	if err != nil {
+		return fmt.Errorf("verify envelope signature: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("invalid envelope signature from sender %x", e.SenderPubKey)
+	}
+
+	if err := i.checkBeaconEntry(e); err != nil {
+		return err
+	}
+
+	if !i.envelopeGuard.Admit(e) {
+		return fmt.Errorf(
+			"duplicate envelope from %x at height %d round %d type %d",
+			e.SenderPubKey, e.Height, e.Round, e.MessageType,
+		)
+	}
+	return nil
+}
+
+// checkBeaconEntry rejects an envelope whose BeaconEntry doesn't match the
+// seed this node expects to be active at e.Height, so a proposer can't
+// substitute its own randomness for the schedule's. This is purely an
+// anti-equivocation check at the gossip boundary: it does not make
+// proposer/leader selection unbiasable or otherwise change which validator
+// core.IBFT picks to propose, which remains its built-in round-robin
+// regardless of BeaconEntry. A nil beaconSchedule (no BeaconSource
+// configured) skips the check entirely.
+func (i *backendIBFT) checkBeaconEntry(e *Envelope) error {
+	if i.beaconSchedule == nil {
+		return nil
+	}
+
+	expected, err := i.beaconSeed(i.currentCtx(), e.Height)
+	if err != nil {
+		return fmt.Errorf("fetch expected beacon entry for height %d: %w", e.Height, err)
+	}
+	if !bytes.Equal(expected, e.BeaconEntry) {
+		return fmt.Errorf("envelope beacon entry at height %d does not match the active schedule", e.Height)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package ibft
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ValidatorSetSource selects where the active validator set is read from.
+type ValidatorSetSource string
+
+const (
+	ValidatorSetSourceStatic  ValidatorSetSource = "static"
+	ValidatorSetSourceStaking ValidatorSetSource = "staking"
+)
+
+// SigningScheme selects how committed seals are produced and verified.
+type SigningScheme string
+
+const (
+	SigningSchemeECDSA SigningScheme = "ecdsa"
+	SigningSchemeBLS   SigningScheme = "bls"
+)
+
+// QuorumRule selects how the 2/3+ threshold is computed over voting powers.
+type QuorumRule string
+
+const (
+	QuorumRuleCount    QuorumRule = "count"    // 2f+1 over validator count
+	QuorumRuleWeighted QuorumRule = "weighted" // 2/3+ over voting power
+)
+
+// ForkParams describes the consensus behavior active for a height range.
+type ForkParams struct {
+	ValidatorSetSource ValidatorSetSource `json:"validatorSetSource"`
+	SigningScheme      SigningScheme      `json:"signingScheme"`
+	QuorumRule         QuorumRule         `json:"quorumRule"`
+}
+
+// defaultForkParams matches the behavior of the repo before fork support was added.
+var defaultForkParams = ForkParams{
+	ValidatorSetSource: ValidatorSetSourceStatic,
+	SigningScheme:      SigningSchemeECDSA,
+	QuorumRule:         QuorumRuleCount,
+}
+
+// forkEntry is the on-disk representation of a single fork activation.
+type forkEntry struct {
+	FromHeight uint64     `json:"fromHeight"`
+	Params     ForkParams `json:"params"`
+}
+
+type forkFile struct {
+	Forks []forkEntry `json:"forks"`
+}
+
+// ForkManager resolves the ForkParams active at a given height. Forks are
+// ordered by FromHeight; the params for a height are those of the latest
+// fork whose FromHeight is <= height.
+type ForkManager struct {
+	mu    sync.RWMutex
+	forks []forkEntry
+}
+
+// NewForkManager returns a ForkManager with a single fork active from
+// genesis, using seed as its params. Passing defaultForkParams reproduces
+// the pre-fork behavior: static validator set, ECDSA seals, count-based
+// quorum.
+func NewForkManager(seed ForkParams) *ForkManager {
+	return &ForkManager{
+		forks: []forkEntry{{FromHeight: 0, Params: seed}},
+	}
+}
+
+// LoadForkManager parses a JSON fork schedule from path. A missing fork at
+// height 0 is synthesized from defaultForkParams so lookups below the
+// lowest configured height still succeed.
+//
+// Only JSON is supported: the repo's go.mod doesn't vendor a YAML library,
+// and this package has no reason to be the first consumer to pull one in.
+func LoadForkManager(path string) (*ForkManager, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fork schedule %q: %w", path, err)
+	}
+
+	var file forkFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse fork schedule %q: %w", path, err)
+	}
+
+	sort.Slice(file.Forks, func(a, b int) bool {
+		return file.Forks[a].FromHeight < file.Forks[b].FromHeight
+	})
+
+	if len(file.Forks) == 0 || file.Forks[0].FromHeight != 0 {
+		file.Forks = append([]forkEntry{{FromHeight: 0, Params: defaultForkParams}}, file.Forks...)
+	}
+
+	return &ForkManager{forks: file.Forks}, nil
+}
+
+// ParamsAt returns the ForkParams active at the given height.
+func (m *ForkManager) ParamsAt(height uint64) ForkParams {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	active := m.forks[0].Params
+	for _, f := range m.forks {
+		if f.FromHeight > height {
+			break
+		}
+		active = f.Params
+	}
+	return active
+}
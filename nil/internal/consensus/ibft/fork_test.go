@@ -0,0 +1,76 @@
+package ibft
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestForkManagerParamsAt(t *testing.T) {
+	m := NewForkManager(defaultForkParams)
+	m.forks = append(m.forks,
+		forkEntry{FromHeight: 100, Params: ForkParams{
+			ValidatorSetSource: ValidatorSetSourceStaking,
+			SigningScheme:      SigningSchemeECDSA,
+			QuorumRule:         QuorumRuleWeighted,
+		}},
+		forkEntry{FromHeight: 200, Params: ForkParams{
+			ValidatorSetSource: ValidatorSetSourceStaking,
+			SigningScheme:      SigningSchemeBLS,
+			QuorumRule:         QuorumRuleWeighted,
+		}},
+	)
+
+	cases := []struct {
+		height uint64
+		want   ForkParams
+	}{
+		{0, defaultForkParams},
+		{99, defaultForkParams},
+		{100, m.forks[1].Params},
+		{150, m.forks[1].Params},
+		{200, m.forks[2].Params},
+		{1_000_000, m.forks[2].Params},
+	}
+	for _, c := range cases {
+		if got := m.ParamsAt(c.height); got != c.want {
+			t.Errorf("ParamsAt(%d) = %+v, want %+v", c.height, got, c.want)
+		}
+	}
+}
+
+func TestLoadForkManager(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "forks.json")
+	contents := `{
+		"forks": [
+			{"fromHeight": 50, "params": {"validatorSetSource": "staking", "signingScheme": "bls", "quorumRule": "weighted"}}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("write fork schedule: %v", err)
+	}
+
+	m, err := LoadForkManager(path)
+	if err != nil {
+		t.Fatalf("LoadForkManager: %v", err)
+	}
+
+	if got := m.ParamsAt(0); got != defaultForkParams {
+		t.Errorf("ParamsAt(0) = %+v, want defaults %+v", got, defaultForkParams)
+	}
+	want := ForkParams{
+		ValidatorSetSource: ValidatorSetSourceStaking,
+		SigningScheme:      SigningSchemeBLS,
+		QuorumRule:         QuorumRuleWeighted,
+	}
+	if got := m.ParamsAt(50); got != want {
+		t.Errorf("ParamsAt(50) = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadForkManagerMissingFile(t *testing.T) {
+	if _, err := LoadForkManager(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("expected an error for a missing fork schedule file")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"math/big"
+	"sync"
+	"sync/atomic"
 
 	"github.com/NilFoundation/nil/nil/common/logging"
 	"github.com/NilFoundation/nil/nil/go-ibft/core"
@@ -17,7 +19,10 @@ import (
 	"github.com/rs/zerolog"
 )
 
-const ibftProto = "/ibft/0.2"
+// ibftProto is bumped to 0.3 for the signed, versioned gossip envelope;
+// ibftProtoV2 (see envelope.go) is kept as a compatibility shim for one
+// release so nodes can roll out the upgrade without a hard fork.
+const ibftProto = "/ibft/0.3"
 
 type ConsensusParams struct {
 	ShardId    types.ShardId
@@ -26,6 +31,49 @@ type ConsensusParams struct {
 	NetManager *network.Manager
 	PrivateKey *ecdsa.PrivateKey
 	Validators []config.ValidatorInfo
+
+	// ForkSchedulePath points at a JSON file mapping height ranges to
+	// ForkParams (see LoadForkManager; YAML is not parsed). If empty, the
+	// fork manager behaves as if no forks were ever scheduled (static
+	// validator set, SealScheme seals, count quorum).
+	ForkSchedulePath string
+
+	// VotingPower supplies per-height validator voting power. If nil, every
+	// validator gets a voting power of 1 (plain count-based quorum).
+	VotingPower VotingPowerProvider
+
+	// SealScheme picks the committed-seal scheme used from genesis. Defaults
+	// to ECDSA. It applies only when no schedule is loaded from
+	// ForkSchedulePath: a loaded schedule replaces it entirely, and heights
+	// below the schedule's first fork use defaultForkParams (ECDSA seals).
+	SealScheme SigningScheme
+
+	// BLSPrivateKey is required when SealScheme (or a scheduled fork) is
+	// SigningSchemeBLS; it is this validator's BLS12-381 signing key.
+	BLSPrivateKey []byte
+
+	// BLSValidators gives each validator's BLS12-381 public key, in the same
+	// order as Validators. Required when SealScheme (or a scheduled fork) is
+	// SigningSchemeBLS: ID() advertises a validator's BLS key (not its
+	// Validators[i].PublicKey) once that scheme is active, so seal
+	// attribution and voting-power lookups must key by this list instead.
+	BLSValidators [][]byte
+
+	// Beacon supplies the randomness seed attached to the context passed to
+	// Validator.BuildProposal for each height and cross-checked on every
+	// gossiped envelope (see envelope.go), so a sender can't gossip under a
+	// seed other than the schedule's. Nothing in this package writes the
+	// seed into the proposal payload itself. It does NOT drive which validator core.IBFT picks as
+	// proposer: that selection is still core.IBFT's own built-in
+	// round-robin, unmodified by this field. If nil, no seed is attached or
+	// checked.
+	Beacon *BeaconSchedule
+
+	// Transport is the pubsub boundary used when NetManager is set (see
+	// transport.go); this package has no adapter for *network.Manager's own
+	// API, so network-mode callers must supply one. Ignored when NetManager
+	// is nil, in which case an in-process loopback transport is used.
+	Transport Transport
 }
 
 type validator interface {
@@ -35,20 +83,71 @@ type validator interface {
 }
 
 type backendIBFT struct {
-	ctx        context.Context
-	db         db.DB
-	consensus  *core.IBFT
-	shardId    types.ShardId
-	validator  validator
-	logger     zerolog.Logger
-	nm         *network.Manager
-	transport  transport
-	signer     *Signer
-	validators []config.ValidatorInfo
+	// ctxValue holds the context.Context passed to the in-flight
+	// RunSequence, stored via setCtx and read via currentCtx. It is an
+	// atomic.Value (not a plain field) because handleInboundEnvelope and
+	// friends (transport.go) read it from a pubsub callback goroutine that
+	// runs concurrently with RunSequence's write; currentCtx also covers the
+	// case where an inbound envelope arrives before this node's first
+	// RunSequence call, which would otherwise read the zero value.
+	ctxValue       atomic.Value
+	db             db.DB
+	consensus      *core.IBFT
+	shardId        types.ShardId
+	validator      validator
+	logger         zerolog.Logger
+	nm             *network.Manager
+	transport      Transport
+	signer         *Signer
+	blsSigner      *BLSSigner
+	validators     []config.ValidatorInfo
+	blsValidators  [][]byte
+	forkManager    *ForkManager
+	votingPower    VotingPowerProvider
+	beaconSchedule *BeaconSchedule
+	wal            *WAL
+	walSeq         atomic.Uint64
+	envelopeGuard  *envelopeReplayGuard
+	nonces         atomic.Uint64
+
+	votingPowersMu     sync.Mutex
+	votingPowersHeight uint64
+	votingPowersCached map[string]*big.Int
+
+	// currentHeight tracks the height passed to the in-flight RunSequence so
+	// Backend callbacks that aren't handed a height directly (InsertProposal,
+	// ID) can still look up the active ForkParams.
+	currentHeight atomic.Uint64
+	currentRound  atomic.Uint64
+
+	// recoveredProposal holds the raw proposal bytes of a locked proposal
+	// replayed from the WAL for the in-flight height (see recoverFromWAL).
+	// BuildProposal returns it unchanged instead of asking the validator to
+	// build a fresh one, so a node that crashed after locking a round
+	// doesn't equivocate on restart. Cleared once consumed.
+	recoveredProposal []byte
 }
 
 var _ core.Backend = &backendIBFT{}
 
+// setCtx atomically stores ctx for use by currentCtx. Called once per
+// RunSequence.
+func (i *backendIBFT) setCtx(ctx context.Context) {
+	i.ctxValue.Store(ctx)
+}
+
+// currentCtx returns the context stored by the most recent setCtx call. It
+// returns context.Background() if setCtx has never been called, e.g. an
+// inbound envelope (see transport.go) arrives before this node's first
+// RunSequence.
+func (i *backendIBFT) currentCtx() context.Context {
+	ctx, _ := i.ctxValue.Load().(context.Context)
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
 func (i *backendIBFT) unmarshalProposal(raw []byte) (*execution.Proposal, error) {
 	proposal := &execution.Proposal{}
 	if err := proposal.UnmarshalSSZ(raw); err != nil {
@@ -58,7 +157,27 @@ func (i *backendIBFT) unmarshalProposal(raw []byte) (*execution.Proposal, error)
 }
 
 func (i *backendIBFT) BuildProposal(view *protoIBFT.View) []byte {
-	proposal, err := i.validator.BuildProposal(i.ctx)
+	fork := i.forkManager.ParamsAt(view.Height)
+
+	if previousRound := i.currentRound.Swap(view.Round); previousRound != view.Round {
+		i.appendWAL(walEntryRoundChange, view.Height, nil)
+	}
+
+	if i.recoveredProposal != nil {
+		proposal := i.recoveredProposal
+		i.recoveredProposal = nil
+		return proposal
+	}
+
+	ctx := i.currentCtx()
+	if seed, err := i.beaconSeed(ctx, view.Height); err != nil {
+		i.logger.Error().Err(err).Uint64(logging.FieldHeight, view.Height).
+			Msg("failed to fetch beacon entry, proceeding without one")
+	} else if seed != nil {
+		ctx = withBeaconEntry(ctx, seed)
+	}
+
+	proposal, err := i.validator.BuildProposal(ctx)
 	if err != nil {
 		return nil
 	}
@@ -66,6 +185,13 @@ func (i *backendIBFT) BuildProposal(view *protoIBFT.View) []byte {
 	if err != nil {
 		return nil
 	}
+
+	i.logger.Debug().
+		Uint64(logging.FieldHeight, view.Height).
+		Str("validatorSetSource", string(fork.ValidatorSetSource)).
+		Str("signingScheme", string(fork.SigningScheme)).
+		Msg("building proposal")
+
 	return data
 }
 
@@ -75,22 +201,65 @@ func (i *backendIBFT) InsertProposal(proposal *protoIBFT.Proposal, committedSeal
 		return
 	}
 
-	var signature types.Signature
-	for _, seal := range committedSeals {
-		if len(seal.Signature) != 0 {
-			signature = seal.Signature
+	height := i.currentHeight.Load()
+	fork := i.forkParamsAtCurrentHeight(height)
+
+	signature, err := i.combineCommittedSeals(fork, committedSeals)
+	if err != nil {
+		i.logger.Error().Err(err).Msg("fail to combine committed seals")
+		return
+	}
+
+	if fork.SigningScheme == SigningSchemeBLS {
+		seal, err := UnmarshalAggregatedSeal(signature)
+		if err != nil {
+			i.logger.Error().Err(err).Msg("fail to decode aggregated BLS seal")
+			return
+		}
+		ok, err := verifyAggregatedSeal(i.blsValidators, seal, proposalDigest(proposal.RawProposal))
+		if err != nil {
+			i.logger.Error().Err(err).Msg("fail to verify aggregated BLS seal")
+			return
+		}
+		if !ok {
+			i.logger.Error().Msg("aggregated BLS seal failed verification, refusing to insert proposal")
+			return
 		}
 	}
 
-	if err := i.validator.InsertProposal(i.ctx, proposalBlock, signature); err != nil {
+	i.appendWAL(walEntryLockedProposal, height, proposal.RawProposal)
+
+	if err := i.validator.InsertProposal(i.currentCtx(), proposalBlock, signature); err != nil {
 		i.logger.Error().Err(err).Msg("fail to insert proposal")
+		return
+	}
+
+	if i.wal != nil {
+		if err := i.wal.Compact(i.currentCtx(), i.shardId, height); err != nil {
+			i.logger.Error().Err(err).Msg("fail to compact consensus WAL")
+		}
 	}
 }
 
+// ID returns this validator's public key under the signing scheme active at
+// the current height, so a fork that switches SigningScheme (ECDSA -> BLS)
+// changes the identity go-ibft advertises for this node, not just the seals
+// it produces.
 func (i *backendIBFT) ID() []byte {
+	fork := i.forkParamsAtCurrentHeight(i.currentHeight.Load())
+	if fork.SigningScheme == SigningSchemeBLS && i.blsSigner != nil {
+		return i.blsSigner.GetPublicKey()
+	}
 	return i.signer.GetPublicKey()
 }
 
+// forkParamsAtCurrentHeight exposes the active ForkParams to the rest of the
+// package (voting power, seal verification, ...) without every call site
+// needing to know how the schedule is stored.
+func (i *backendIBFT) forkParamsAtCurrentHeight(height uint64) ForkParams {
+	return i.forkManager.ParamsAt(height)
+}
+
 func (i *backendIBFT) isActiveValidator() bool {
 	return true
 }
@@ -101,25 +270,124 @@ func NewConsensus(cfg *ConsensusParams) *backendIBFT {
 		logger: logger.With().CallerWithSkipFrameCount(3).Logger(),
 	}
 
+	genesisForkParams := defaultForkParams
+	if cfg.SealScheme != "" {
+		genesisForkParams.SigningScheme = cfg.SealScheme
+	}
+	forkManager := NewForkManager(genesisForkParams)
+	if cfg.ForkSchedulePath != "" {
+		loaded, err := LoadForkManager(cfg.ForkSchedulePath)
+		if err != nil {
+			logger.Error().Err(err).Str("path", cfg.ForkSchedulePath).
+				Msg("failed to load fork schedule, falling back to defaults")
+		} else {
+			forkManager = loaded
+		}
+	}
+
+	var blsSigner *BLSSigner
+	if len(cfg.BLSPrivateKey) != 0 {
+		signer, err := NewBLSSigner(cfg.BLSPrivateKey)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to initialize BLS signer")
+		} else {
+			blsSigner = signer
+		}
+	}
+
 	backend := &backendIBFT{
-		db:         cfg.Db,
-		shardId:    cfg.ShardId,
-		validator:  cfg.Validator,
-		logger:     logger,
-		nm:         cfg.NetManager,
-		signer:     NewSigner(cfg.PrivateKey),
-		validators: cfg.Validators,
+		db:             cfg.Db,
+		shardId:        cfg.ShardId,
+		validator:      cfg.Validator,
+		logger:         logger,
+		nm:             cfg.NetManager,
+		transport:      cfg.Transport,
+		signer:         NewSigner(cfg.PrivateKey),
+		blsSigner:      blsSigner,
+		validators:     cfg.Validators,
+		blsValidators:  cfg.BLSValidators,
+		forkManager:    forkManager,
+		votingPower:    cfg.VotingPower,
+		beaconSchedule: cfg.Beacon,
+		envelopeGuard:  newEnvelopeReplayGuard(),
+	}
+	if cfg.Db != nil {
+		backend.wal = NewWAL(cfg.Db)
 	}
 	backend.consensus = core.NewIBFT(l, backend, backend)
 	return backend
 }
 
+// GetVotingPowers returns the voting power of each validator, keyed by the
+// same pubkey bytes ID() advertises for that validator under the active
+// fork: the BLS key (ConsensusParams.BLSValidators) under SigningSchemeBLS,
+// the static config.ValidatorInfo.PublicKey otherwise. core.IBFT matches
+// these keys against message senders' ID() to compute quorum, so a mismatch
+// here would make every validator's vote invisible to quorum counting under
+// BLS. The result is snapshotted at the start of the sequence for height
+// (see RunSequence) so validator set churn mid-sequence cannot change the
+// quorum math for a round already in flight.
+//
+// The active ForkParams drives both other dimensions the fork schedule
+// controls: ValidatorSetSource picks whether weights come from the
+// pluggable VotingPowerProvider (ValidatorSetSourceStaking) or the static
+// validator list (ValidatorSetSourceStatic), and QuorumRule picks whether
+// those weights are used as-is (QuorumRuleWeighted) or flattened to 1 per
+// validator (QuorumRuleCount), reproducing plain count-based quorum.
 func (i *backendIBFT) GetVotingPowers(height uint64) (map[string]*big.Int, error) {
-	result := make(map[string]*big.Int, len(i.validators))
-	for _, v := range i.validators {
-		result[string(v.PublicKey[:])] = big.NewInt(1)
+	i.votingPowersMu.Lock()
+	defer i.votingPowersMu.Unlock()
+
+	if i.votingPowersCached != nil && i.votingPowersHeight == height {
+		return i.votingPowersCached, nil
+	}
+
+	fork := i.forkManager.ParamsAt(height)
+
+	provider := i.votingPowerProvider()
+	if fork.ValidatorSetSource != ValidatorSetSourceStaking {
+		provider = newStaticVotingPowerProvider(i.validators)
+	}
+
+	powers, err := provider.VotingPowers(i.currentCtx(), height)
+	if err != nil {
+		return nil, err
+	}
+
+	if fork.QuorumRule != QuorumRuleWeighted {
+		flattened := make(map[string]*big.Int, len(powers))
+		for k := range powers {
+			flattened[k] = big.NewInt(1)
+		}
+		powers = flattened
+	}
+
+	if fork.SigningScheme == SigningSchemeBLS {
+		powers = rekeyToBLSIdentity(i.validators, i.blsValidators, powers)
+	}
+
+	i.votingPowersHeight = height
+	i.votingPowersCached = powers
+	return powers, nil
+}
+
+// rekeyToBLSIdentity re-keys a voting-power map (keyed by
+// config.ValidatorInfo.PublicKey, as every VotingPowerProvider returns it)
+// by each validator's BLS public key instead, so the result matches the
+// identity ID() advertises once SigningSchemeBLS is active. A validator
+// missing a BLSValidators entry is dropped rather than left keyed by an
+// identity no seal or message will ever carry.
+func rekeyToBLSIdentity(validators []config.ValidatorInfo, blsValidators [][]byte, powers map[string]*big.Int) map[string]*big.Int {
+	rekeyed := make(map[string]*big.Int, len(powers))
+	for idx, v := range validators {
+		if idx >= len(blsValidators) || len(blsValidators[idx]) == 0 {
+			continue
+		}
+		if power, ok := powers[string(v.PublicKey[:])]; ok {
+			rekeyed[string(blsValidators[idx])] = power
+		}
 	}
-	return result, nil
+	return rekeyed
 }
 
 func (i *backendIBFT) Init(ctx context.Context) error {
@@ -131,7 +399,24 @@ func (i *backendIBFT) Init(ctx context.Context) error {
 }
 
 func (i *backendIBFT) RunSequence(ctx context.Context, height uint64) error {
-	i.ctx = ctx
+	i.setCtx(ctx)
+	i.currentHeight.Store(height)
+	i.currentRound.Store(0)
+	i.recoveredProposal = nil
+
+	locked, lockedProposal, err := i.recoverFromWAL(ctx, height)
+	if err != nil {
+		i.logger.Error().Err(err).Uint64(logging.FieldHeight, height).
+			Msg("failed to recover consensus WAL, continuing without replay")
+	} else if locked {
+		i.recoveredProposal = lockedProposal
+	}
+
+	if _, err := i.GetVotingPowers(height); err != nil {
+		i.logger.Error().Err(err).Uint64(logging.FieldHeight, height).
+			Msg("failed to snapshot voting powers at sequence start")
+	}
+
 	i.consensus.RunSequence(ctx, height)
 	return nil
 }
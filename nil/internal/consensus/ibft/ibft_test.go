@@ -0,0 +1,43 @@
+package ibft
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/NilFoundation/nil/nil/internal/config"
+)
+
+func TestRekeyToBLSIdentity(t *testing.T) {
+	var validators []config.ValidatorInfo
+	for idx := 0; idx < 3; idx++ {
+		var v config.ValidatorInfo
+		copy(v.PublicKey[:], []byte{byte(idx)})
+		validators = append(validators, v)
+	}
+	blsValidators := [][]byte{
+		[]byte("bls-pubkey-0"),
+		[]byte("bls-pubkey-1"),
+		nil, // validator 2 has no configured BLS key
+	}
+
+	powers := map[string]*big.Int{
+		string(validators[0].PublicKey[:]): big.NewInt(10),
+		string(validators[1].PublicKey[:]): big.NewInt(20),
+		string(validators[2].PublicKey[:]): big.NewInt(30),
+	}
+
+	rekeyed := rekeyToBLSIdentity(validators, blsValidators, powers)
+
+	if len(rekeyed) != 2 {
+		t.Fatalf("got %d rekeyed entries, want 2 (validator 2 has no BLSValidators entry)", len(rekeyed))
+	}
+	if got := rekeyed[string(blsValidators[0])]; got == nil || got.Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("rekeyed[bls-pubkey-0] = %v, want 10", got)
+	}
+	if got := rekeyed[string(blsValidators[1])]; got == nil || got.Cmp(big.NewInt(20)) != 0 {
+		t.Errorf("rekeyed[bls-pubkey-1] = %v, want 20", got)
+	}
+	if _, ok := rekeyed[string(validators[2].PublicKey[:])]; ok {
+		t.Error("validator 2's static ECDSA identity should not appear in a BLS-rekeyed map")
+	}
+}
@@ -0,0 +1,164 @@
+package ibft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	protoIBFT "github.com/NilFoundation/nil/nil/go-ibft/messages/proto"
+)
+
+// Transport is the pubsub boundary backendIBFT exchanges consensus messages
+// over. It is intentionally narrow (publish/subscribe by topic) so this
+// package doesn't need to assume anything about *network.Manager's actual
+// API; a caller running in network mode supplies a concrete implementation
+// via ConsensusParams.Transport, adapting whatever network.Manager exposes.
+type Transport interface {
+	Publish(topic string, data []byte) error
+	Subscribe(topic string, handler func(data []byte)) error
+}
+
+// localTransport is an in-process loopback transport: Publish delivers
+// synchronously to every handler already Subscribed on the same topic. It's
+// enough for a single local validator (no NetManager configured) or for
+// tests, and lets Multicast/receive wiring be exercised without a real p2p
+// stack.
+type localTransport struct {
+	mu       sync.Mutex
+	handlers map[string][]func([]byte)
+}
+
+func newLocalTransport() *localTransport {
+	return &localTransport{handlers: make(map[string][]func([]byte))}
+}
+
+func (t *localTransport) Publish(topic string, data []byte) error {
+	t.mu.Lock()
+	handlers := append([]func([]byte){}, t.handlers[topic]...)
+	t.mu.Unlock()
+
+	for _, h := range handlers {
+		h(data)
+	}
+	return nil
+}
+
+func (t *localTransport) Subscribe(topic string, handler func([]byte)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[topic] = append(t.handlers[topic], handler)
+	return nil
+}
+
+// setupLocalTransport wires a loopback transport for single-node operation
+// (ConsensusParams.NetManager was left nil).
+func (i *backendIBFT) setupLocalTransport() {
+	i.transport = newLocalTransport()
+	if err := i.subscribeConsensusTopics(); err != nil {
+		i.logger.Error().Err(err).Msg("failed to subscribe local consensus transport")
+	}
+}
+
+// setupTransport wires the real network-mode transport. This package does
+// not itself adapt *network.Manager's pubsub API (that would be the same
+// kind of unverified-API guess flagged on the staking VotingPowerProvider);
+// the caller is expected to have supplied one via ConsensusParams.Transport.
+func (i *backendIBFT) setupTransport(ctx context.Context) error {
+	if i.transport == nil {
+		return fmt.Errorf("network mode (NetManager set) requires ConsensusParams.Transport to be supplied")
+	}
+	return i.subscribeConsensusTopics()
+}
+
+// subscribeConsensusTopics registers handlers for both the current envelope
+// protocol and the 0.2 compatibility shim.
+func (i *backendIBFT) subscribeConsensusTopics() error {
+	if err := i.transport.Subscribe(ibftProto, i.handleInboundEnvelope); err != nil {
+		return fmt.Errorf("subscribe %s: %w", ibftProto, err)
+	}
+	if err := i.transport.Subscribe(ibftProtoV2, i.handleInboundLegacy); err != nil {
+		return fmt.Errorf("subscribe %s: %w", ibftProtoV2, err)
+	}
+	return nil
+}
+
+// Multicast implements go-ibft core's Transport dependency (core.NewIBFT is
+// handed backendIBFT for both its Backend and Transport arguments). Every
+// outbound message is WAL-logged, wrapped in a signed, versioned Envelope,
+// and gossiped on ibftProto.
+func (i *backendIBFT) Multicast(msg *protoIBFT.Message) {
+	payload, err := msg.Marshal()
+	if err != nil {
+		i.logger.Error().Err(err).Msg("fail to marshal outbound consensus message")
+		return
+	}
+
+	height := i.currentHeight.Load()
+	round := i.currentRound.Load()
+	if view := msg.View; view != nil {
+		height, round = view.Height, view.Round
+	}
+
+	i.appendWAL(walEntryOutboundMessage, height, payload)
+
+	env := i.newEnvelope(int32(msg.Type), height, round, payload)
+	if err := env.sign(i.signer); err != nil {
+		i.logger.Error().Err(err).Msg("fail to sign outbound envelope")
+		return
+	}
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		i.logger.Error().Err(err).Msg("fail to marshal outbound envelope")
+		return
+	}
+
+	if i.transport == nil {
+		return
+	}
+	if err := i.transport.Publish(ibftProto, data); err != nil {
+		i.logger.Error().Err(err).Msg("fail to publish consensus envelope")
+	}
+}
+
+// handleInboundEnvelope is the ibftProto subscription handler: it verifies
+// the envelope (version, signature, replay) before WAL-logging the message
+// and handing it to core.IBFT.
+func (i *backendIBFT) handleInboundEnvelope(data []byte) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		i.logger.Error().Err(err).Msg("fail to unmarshal inbound envelope")
+		return
+	}
+
+	if err := i.verifyEnvelope(&env); err != nil {
+		i.logger.Warn().Err(err).Msg("dropping inbound consensus envelope")
+		return
+	}
+
+	i.appendWAL(walEntryInboundMessage, env.Height, env.Payload)
+	i.deliverToConsensus(env.Payload)
+}
+
+// handleInboundLegacy is the ibftProtoV2 subscription handler kept for one
+// release as a compatibility shim: peers still on 0.2 send bare messages
+// with no envelope, so there is no signature or replay check to run here.
+// Remove this path (and ibftProtoV2) once the network has fully migrated.
+func (i *backendIBFT) handleInboundLegacy(data []byte) {
+	i.appendWAL(walEntryInboundMessage, i.currentHeight.Load(), data)
+	i.deliverToConsensus(data)
+}
+
+// deliverToConsensus hands a verified message payload to core.IBFT. The
+// exact intake method is part of go-ibft's core, not this package; AddMessage
+// is the conventional name for that hook in this family of IBFT
+// implementations.
+func (i *backendIBFT) deliverToConsensus(payload []byte) {
+	msg := &protoIBFT.Message{}
+	if err := msg.Unmarshal(payload); err != nil {
+		i.logger.Error().Err(err).Msg("fail to unmarshal consensus message payload")
+		return
+	}
+	i.consensus.AddMessage(msg)
+}
@@ -0,0 +1,143 @@
+package ibft
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/NilFoundation/nil/nil/internal/config"
+)
+
+// VotingPowerProvider resolves the voting power of each validator at a given
+// height. Implementations may read stake from chain state, a static config,
+// or any other source; results are expected to be deterministic for a given
+// height so all validators compute the same quorum.
+type VotingPowerProvider interface {
+	// VotingPowers returns a map from the compressed validator pubkey
+	// (as used by config.ValidatorInfo.PublicKey) to its voting power at
+	// height. It must return a deterministic error if total stake is zero.
+	VotingPowers(ctx context.Context, height uint64) (map[string]*big.Int, error)
+}
+
+// staticVotingPowerProvider assigns every validator a voting power of 1,
+// reproducing the plain count-based quorum this package used before stake
+// weighting was added.
+type staticVotingPowerProvider struct {
+	validators []config.ValidatorInfo
+}
+
+func newStaticVotingPowerProvider(validators []config.ValidatorInfo) *staticVotingPowerProvider {
+	return &staticVotingPowerProvider{validators: validators}
+}
+
+func (p *staticVotingPowerProvider) VotingPowers(context.Context, uint64) (map[string]*big.Int, error) {
+	result := make(map[string]*big.Int, len(p.validators))
+	for _, v := range p.validators {
+		result[string(v.PublicKey[:])] = big.NewInt(1)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("total voting power is zero: no validators configured")
+	}
+	return result, nil
+}
+
+// StakeReader resolves validator stake as of a height. It exists so this
+// package doesn't hard-depend on the exact shape of execution's state
+// access; the caller that wires up a stake-backed VotingPowerProvider (in
+// node construction code, outside this package) is responsible for
+// supplying an adapter over whatever execution actually exposes for reading
+// the staking contract/precompile.
+type StakeReader interface {
+	// ReadValidatorStakes returns a map from the compressed validator
+	// pubkey to its stake at height. An empty, nil-error result means the
+	// staking contract has no entries yet (e.g. pre-activation).
+	ReadValidatorStakes(ctx context.Context, height uint64) (map[string]*big.Int, error)
+}
+
+// stakingPowerProvider reads validator stake from a StakeReader at the
+// requested height, falling back to the static weights when the contract
+// has no entries at all. A validator missing from a non-empty stake map
+// gets no voting power. Results are cached per epoch since stake only
+// changes at epoch boundaries.
+type stakingPowerProvider struct {
+	state    StakeReader
+	fallback *staticVotingPowerProvider
+
+	epochLength uint64
+
+	mu          sync.Mutex
+	cachedEpoch uint64
+	cached      map[string]*big.Int
+	cachedOK    bool
+}
+
+// NewStakingVotingPowerProvider builds a VotingPowerProvider that reads
+// weights from state, falling back to the static config weights when chain
+// state has no stake entries at all.
+func NewStakingVotingPowerProvider(
+	state StakeReader,
+	validators []config.ValidatorInfo,
+	epochLength uint64,
+) VotingPowerProvider {
+	if epochLength == 0 {
+		epochLength = 1
+	}
+	return &stakingPowerProvider{
+		state:       state,
+		fallback:    newStaticVotingPowerProvider(validators),
+		epochLength: epochLength,
+	}
+}
+
+func (p *stakingPowerProvider) VotingPowers(ctx context.Context, height uint64) (map[string]*big.Int, error) {
+	epoch := height / p.epochLength
+
+	p.mu.Lock()
+	if p.cachedOK && p.cachedEpoch == epoch {
+		cached := p.cached
+		p.mu.Unlock()
+		return cached, nil
+	}
+	p.mu.Unlock()
+
+	powers, err := p.state.ReadValidatorStakes(ctx, height)
+	if err != nil {
+		return nil, fmt.Errorf("read validator stakes at height %d: %w", height, err)
+	}
+
+	if len(powers) == 0 {
+		// Chain state has no stake entries yet (e.g. pre-activation): use
+		// the static weights so quorum keeps working.
+		powers, err = p.fallback.VotingPowers(ctx, height)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	total := new(big.Int)
+	for _, w := range powers {
+		total.Add(total, w)
+	}
+	if total.Sign() == 0 {
+		return nil, fmt.Errorf("total voting power at height %d is zero", height)
+	}
+
+	p.mu.Lock()
+	p.cachedEpoch = epoch
+	p.cached = powers
+	p.cachedOK = true
+	p.mu.Unlock()
+
+	return powers, nil
+}
+
+// votingPowerProvider returns the configured VotingPowerProvider, falling
+// back to a static count-based provider so GetVotingPowers keeps working
+// when ConsensusParams.VotingPower is left unset.
+func (i *backendIBFT) votingPowerProvider() VotingPowerProvider {
+	if i.votingPower != nil {
+		return i.votingPower
+	}
+	return newStaticVotingPowerProvider(i.validators)
+}
@@ -0,0 +1,43 @@
+package ibft
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/NilFoundation/nil/nil/internal/config"
+)
+
+type fakeStakeReader struct {
+	stakes map[string]*big.Int
+	err    error
+}
+
+func (f *fakeStakeReader) ReadValidatorStakes(context.Context, uint64) (map[string]*big.Int, error) {
+	return f.stakes, f.err
+}
+
+func TestStakingPowerProviderFallsBackWhenEmpty(t *testing.T) {
+	validators := []config.ValidatorInfo{{}, {}}
+	provider := NewStakingVotingPowerProvider(&fakeStakeReader{stakes: map[string]*big.Int{}}, validators, 10)
+
+	powers, err := provider.VotingPowers(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("VotingPowers: %v", err)
+	}
+	if len(powers) != len(validators) {
+		t.Fatalf("got %d powers, want %d (static fallback)", len(powers), len(validators))
+	}
+}
+
+func TestStakingPowerProviderZeroTotalIsError(t *testing.T) {
+	provider := NewStakingVotingPowerProvider(
+		&fakeStakeReader{stakes: map[string]*big.Int{"a": big.NewInt(0)}},
+		nil,
+		1,
+	)
+
+	if _, err := provider.VotingPowers(context.Background(), 1); err == nil {
+		t.Fatal("expected an error when total voting power is zero")
+	}
+}
@@ -0,0 +1,212 @@
+package ibft
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/NilFoundation/nil/nil/common/logging"
+	"github.com/NilFoundation/nil/nil/internal/db"
+	"github.com/NilFoundation/nil/nil/internal/types"
+)
+
+// walEntryKind distinguishes the events the WAL records for a round, so
+// replay can tell a lock from a plain message without re-deriving it.
+type walEntryKind uint8
+
+const (
+	walEntryInboundMessage walEntryKind = iota
+	walEntryOutboundMessage
+	walEntryRoundChange
+	walEntryLockedProposal
+)
+
+// walEntry is one record in the write-ahead log: every inbound/outbound
+// consensus message, each locked proposal, and each round change that
+// BuildProposal observes is appended before it is acted on, so a crash between "decided to act" and "acted" can be replayed
+// instead of silently dropped.
+type walEntry struct {
+	ShardId types.ShardId `json:"shardId"`
+	Height  uint64        `json:"height"`
+	Round   uint64        `json:"round"`
+	Kind    walEntryKind  `json:"kind"`
+	Payload []byte        `json:"payload"`
+}
+
+var walTableName = "ConsensusWAL"
+
+// WAL persists consensus messages and state transitions via db.DB so a
+// validator that restarts mid-round keeps its locked proposal (see
+// recoverFromWAL). Only the last locked proposal is recovered; logged
+// messages and round changes are not replayed into core.IBFT.
+type WAL struct {
+	db db.DB
+}
+
+// NewWAL wraps store for use as a consensus write-ahead log.
+func NewWAL(store db.DB) *WAL {
+	return &WAL{db: store}
+}
+
+// walKey orders entries by (shardId, height, round, sequence) so a range
+// scan over a single height returns entries in the order they were
+// appended.
+func walKey(shardId types.ShardId, height, round, seq uint64) []byte {
+	key := make([]byte, 8+8+8+8)
+	binary.BigEndian.PutUint64(key[0:8], uint64(shardId))
+	binary.BigEndian.PutUint64(key[8:16], height)
+	binary.BigEndian.PutUint64(key[16:24], round)
+	binary.BigEndian.PutUint64(key[24:32], seq)
+	return key
+}
+
+func walHeightPrefix(shardId types.ShardId, height uint64) []byte {
+	prefix := make([]byte, 16)
+	binary.BigEndian.PutUint64(prefix[0:8], uint64(shardId))
+	binary.BigEndian.PutUint64(prefix[8:16], height)
+	return prefix
+}
+
+// Append persists entry before it is acted on. The caller picks seq so
+// concurrent appends within the same (shardId, height, round) don't collide;
+// backendIBFT uses a single monotonic counter (walSeq) shared by all rounds
+// and heights, kept in memory only.
+func (w *WAL) Append(ctx context.Context, entry walEntry, seq uint64) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal WAL entry: %w", err)
+	}
+
+	tx, err := w.db.CreateRwTx(ctx)
+	if err != nil {
+		return fmt.Errorf("open WAL write tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.Put(walTableName, walKey(entry.ShardId, entry.Height, entry.Round, seq), data); err != nil {
+		return fmt.Errorf("write WAL entry: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ReplayHeight returns every entry appended for (shardId, height), in append
+// order, so RunSequence (via recoverFromWAL) can recover the lock for the
+// height it crashed on. Init does not replay the WAL.
+func (w *WAL) ReplayHeight(ctx context.Context, shardId types.ShardId, height uint64) ([]walEntry, error) {
+	tx, err := w.db.CreateRoTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open WAL read tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	iter, err := tx.Range(walTableName, walHeightPrefix(shardId, height), walHeightPrefix(shardId, height+1))
+	if err != nil {
+		return nil, fmt.Errorf("scan WAL for height %d: %w", height, err)
+	}
+	defer iter.Close()
+
+	var entries []walEntry
+	for iter.HasNext() {
+		_, value, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("iterate WAL for height %d: %w", height, err)
+		}
+		var entry walEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return nil, fmt.Errorf("unmarshal WAL entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Compact drops every WAL entry at or below belowHeight, the last height
+// whose block was durably inserted; the state those entries could replay
+// into is already committed, so replaying them again would be redundant.
+func (w *WAL) Compact(ctx context.Context, shardId types.ShardId, belowHeight uint64) error {
+	tx, err := w.db.CreateRwTx(ctx)
+	if err != nil {
+		return fmt.Errorf("open WAL compaction tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	iter, err := tx.Range(walTableName, walHeightPrefix(shardId, 0), walHeightPrefix(shardId, belowHeight+1))
+	if err != nil {
+		return fmt.Errorf("scan WAL for compaction: %w", err)
+	}
+
+	var keys [][]byte
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			iter.Close()
+			return fmt.Errorf("iterate WAL for compaction: %w", err)
+		}
+		keys = append(keys, append([]byte(nil), key...))
+	}
+	iter.Close()
+
+	for _, key := range keys {
+		if err := tx.Delete(walTableName, key); err != nil {
+			return fmt.Errorf("delete compacted WAL entry: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// appendWAL best-effort persists a WAL entry for the in-flight round. A
+// write failure is logged but does not block consensus progress: the WAL is
+// a crash-recovery aid, not a correctness requirement for the happy path.
+func (i *backendIBFT) appendWAL(kind walEntryKind, height uint64, payload []byte) {
+	if i.wal == nil {
+		return
+	}
+
+	entry := walEntry{
+		ShardId: i.shardId,
+		Height:  height,
+		Round:   i.currentRound.Load(),
+		Kind:    kind,
+		Payload: payload,
+	}
+	if err := i.wal.Append(i.currentCtx(), entry, i.walSeq.Add(1)); err != nil {
+		i.logger.Error().Err(err).Uint64(logging.FieldHeight, height).Msg("fail to append consensus WAL entry")
+	}
+}
+
+// lockedProposalFromEntries scans WAL entries replayed for a height and
+// returns the raw proposal bytes of the last walEntryLockedProposal entry
+// found, so recoverFromWAL's replay-fold logic can be tested without a live
+// db.DB.
+func lockedProposalFromEntries(entries []walEntry) (locked bool, proposal []byte) {
+	for _, entry := range entries {
+		if entry.Kind == walEntryLockedProposal {
+			locked = true
+			proposal = entry.Payload
+		}
+	}
+	return locked, proposal
+}
+
+// recoverFromWAL replays the WAL for height and reports the raw proposal
+// bytes of the last locked proposal found, so BuildProposal re-proposes that
+// proposal instead of building a fresh one. Messages sent before the crash
+// are not replayed, so votes already cast are not restored. A nil slice with locked == false means nothing was locked.
+func (i *backendIBFT) recoverFromWAL(ctx context.Context, height uint64) (locked bool, lockedProposal []byte, err error) {
+	if i.wal == nil {
+		return false, nil, nil
+	}
+
+	entries, err := i.wal.ReplayHeight(ctx, i.shardId, height)
+	if err != nil {
+		return false, nil, fmt.Errorf("replay WAL at height %d: %w", height, err)
+	}
+
+	locked, lockedProposal = lockedProposalFromEntries(entries)
+	if locked {
+		i.logger.Warn().Uint64(logging.FieldHeight, height).
+			Msg("recovered a locked proposal from WAL, resuming round instead of re-proposing")
+	}
+	return locked, lockedProposal, nil
+}